@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// configFile is the on-disk shape of a -config file: a flat list of rules,
+// each matching ForwardConfig's fields plus a name to identify it by in logs
+// and on reload. The format is JSON only; there is no YAML support.
+type configFile struct {
+	Rules []ruleFile `json:"rules"`
+}
+
+// ruleFile mirrors Rule, except IdleTimeout is a duration string (e.g.
+// "30s") rather than a time.Duration, since encoding/json has no built-in
+// support for time.Duration, and Fork is a *bool so that an omitted value can
+// be told apart from an explicit false.
+type ruleFile struct {
+	Name                  string `json:"name"`
+	ListenType            string `json:"listen_type"`
+	ListenAddr            string `json:"listen_addr"`
+	ConnectType           string `json:"connect_type"`
+	ConnectAddr           string `json:"connect_addr"`
+	Fork                  *bool  `json:"fork"`
+	IdleTimeout           string `json:"idle_timeout"`
+	AcceptProxy           bool   `json:"accept_proxy"`
+	SendProxy             string `json:"send_proxy"`
+	TLSCertFile           string `json:"tls_cert"`
+	TLSKeyFile            string `json:"tls_key"`
+	TLSCAFile             string `json:"tls_ca"`
+	TLSServerName         string `json:"tls_server_name"`
+	TLSALPN               string `json:"tls_alpn"`
+	TLSInsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// loadRules reads and validates the rules described by a -config file.
+func loadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var cf configFile
+	if err := json.Unmarshal(data, &cf); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	if len(cf.Rules) == 0 {
+		return nil, fmt.Errorf("config file %s defines no rules", path)
+	}
+
+	seen := make(map[string]bool, len(cf.Rules))
+	rules := make([]Rule, 0, len(cf.Rules))
+	for i, rf := range cf.Rules {
+		rule, err := rf.toRule(i)
+		if err != nil {
+			return nil, err
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("duplicate rule name %q", rule.Name)
+		}
+		seen[rule.Name] = true
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// toRule converts a parsed ruleFile into a Rule, defaulting Name to
+// "rule-<index>" (its index in the file) and Fork to true, matching the
+// command-line flag default.
+func (rf ruleFile) toRule(index int) (Rule, error) {
+	name := rf.Name
+	if name == "" {
+		name = fmt.Sprintf("rule-%d", index)
+	}
+
+	if rf.ListenAddr == "" || rf.ConnectAddr == "" {
+		return Rule{}, fmt.Errorf("rule %q: listen_addr and connect_addr are required", name)
+	}
+
+	fork := true
+	if rf.Fork != nil {
+		fork = *rf.Fork
+	}
+
+	idleTimeout := 60 * time.Second
+	if rf.IdleTimeout != "" {
+		d, err := time.ParseDuration(rf.IdleTimeout)
+		if err != nil {
+			return Rule{}, fmt.Errorf("rule %q: invalid idle_timeout %q: %v", name, rf.IdleTimeout, err)
+		}
+		idleTimeout = d
+	}
+
+	return Rule{
+		Name: name,
+		ForwardConfig: ForwardConfig{
+			ListenType:            rf.ListenType,
+			ListenAddr:            rf.ListenAddr,
+			ConnectType:           rf.ConnectType,
+			ConnectAddr:           rf.ConnectAddr,
+			Fork:                  fork,
+			IdleTimeout:           idleTimeout,
+			AcceptProxy:           rf.AcceptProxy,
+			SendProxyVersion:      rf.SendProxy,
+			TLSCertFile:           rf.TLSCertFile,
+			TLSKeyFile:            rf.TLSKeyFile,
+			TLSCAFile:             rf.TLSCAFile,
+			TLSServerName:         rf.TLSServerName,
+			TLSALPN:               rf.TLSALPN,
+			TLSInsecureSkipVerify: rf.TLSInsecureSkipVerify,
+		},
+	}, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// connTracker records every connection currently being forwarded for one
+// rule, so that a graceful shutdown can wait for them to finish on their own
+// and, if a deadline passes, forcibly unblock whatever is still stuck.
+type connTracker struct {
+	mu    sync.Mutex
+	wg    sync.WaitGroup
+	conns map[net.Conn]struct{}
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: make(map[net.Conn]struct{})}
+}
+
+// add registers conn as in-flight. Every add must be matched by exactly one
+// remove.
+func (t *connTracker) add(conn net.Conn) {
+	t.mu.Lock()
+	t.conns[conn] = struct{}{}
+	t.mu.Unlock()
+	t.wg.Add(1)
+}
+
+// remove unregisters conn once it has been fully closed.
+func (t *connTracker) remove(conn net.Conn) {
+	t.mu.Lock()
+	delete(t.conns, conn)
+	t.mu.Unlock()
+	t.wg.Done()
+}
+
+// drain waits up to timeout for every tracked connection to finish on its
+// own. If the timeout elapses first, it calls SetDeadline(time.Now()) on each
+// connection still tracked to unblock its forwarding goroutines' io.Copy (the
+// same technique the stdlib net tests use to force a stuck Read to return),
+// and returns how many connections had to be force-closed this way.
+func (t *connTracker) drain(timeout time.Duration) int {
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return 0
+	case <-time.After(timeout):
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for conn := range t.conns {
+		if err := conn.SetDeadline(time.Now()); err != nil {
+			log.Printf("Failed to force-unblock connection during shutdown: %v", err)
+		}
+	}
+	return len(t.conns)
+}
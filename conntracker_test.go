@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnTracker_DrainReturnsImmediatelyWhenEmpty(t *testing.T) {
+	tracker := newConnTracker()
+
+	start := time.Now()
+	forced := tracker.drain(time.Second)
+	if forced != 0 {
+		t.Errorf("Expected 0 force-closed connections, got %d", forced)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("Expected drain to return immediately, took %v", elapsed)
+	}
+}
+
+func TestConnTracker_DrainForceClosesAfterTimeout(t *testing.T) {
+	serverListener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to create test listener: %v", err)
+	}
+	defer serverListener.Close()
+
+	serverDone := make(chan net.Conn, 1)
+	go func() {
+		conn, err := serverListener.Accept()
+		if err == nil {
+			serverDone <- conn
+		}
+	}()
+
+	clientConn, err := net.Dial("tcp", serverListener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial test listener: %v", err)
+	}
+	defer clientConn.Close()
+
+	serverConn := <-serverDone
+	defer serverConn.Close()
+
+	tracker := newConnTracker()
+	tracker.add(serverConn)
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := serverConn.Read(make([]byte, 1))
+		readErr <- err
+	}()
+
+	forced := tracker.drain(100 * time.Millisecond)
+	if forced != 1 {
+		t.Errorf("Expected 1 force-closed connection, got %d", forced)
+	}
+
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Error("Expected blocked Read to be unblocked with an error")
+		}
+	case <-time.After(time.Second):
+		t.Error("Read was not unblocked by drain's forced deadline")
+	}
+}
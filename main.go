@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"io"
@@ -9,26 +10,49 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
 type ForwardConfig struct {
-	ListenType  string
-	ListenAddr  string
-	ConnectType string
-	ConnectAddr string
-	Fork        bool
+	ListenType            string
+	ListenAddr            string
+	ConnectType           string
+	ConnectAddr           string
+	Fork                  bool
+	IdleTimeout           time.Duration
+	AcceptProxy           bool
+	SendProxyVersion      string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSCAFile             string
+	TLSServerName         string
+	TLSALPN               string
+	TLSInsecureSkipVerify bool
 }
 
 func main() {
 	var config ForwardConfig
+	var configPath string
+	var shutdownTimeout time.Duration
 
-	flag.StringVar(&config.ListenType, "listen-type", "tcp", "Listen type: tcp, unix")
+	flag.StringVar(&config.ListenType, "listen-type", "tcp", "Listen type: tcp, unix, unixpacket, udp, unixgram, tls")
 	flag.StringVar(&config.ListenAddr, "listen-addr", "", "Listen address")
-	flag.StringVar(&config.ConnectType, "connect-type", "unix", "Connect type: tcp, unix, abstract")
+	flag.StringVar(&config.ConnectType, "connect-type", "unix", "Connect type: tcp, unix, abstract, unixpacket, udp, unixgram, tls-client")
 	flag.StringVar(&config.ConnectAddr, "connect-addr", "", "Connect address")
 	flag.BoolVar(&config.Fork, "fork", true, "Fork connections (handle multiple concurrent connections)")
+	flag.DurationVar(&config.IdleTimeout, "idle-timeout", 60*time.Second, "Idle session timeout for datagram forwarding (udp, unixgram)")
+	flag.StringVar(&configPath, "config", "", "Path to a JSON (not YAML) config file describing multiple forward rules (overrides the single-rule flags above)")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "How long to wait for in-flight connections to finish on shutdown before forcibly closing them")
+	flag.BoolVar(&config.AcceptProxy, "accept-proxy", false, "Parse a PROXY protocol v1/v2 header off each accepted connection before forwarding")
+	flag.StringVar(&config.SendProxyVersion, "send-proxy", "", "Emit a PROXY protocol header to the target before forwarding: v1 or v2")
+	flag.StringVar(&config.TLSCertFile, "tls-cert", "", "TLS certificate file (PEM), required when -listen-type=tls")
+	flag.StringVar(&config.TLSKeyFile, "tls-key", "", "TLS private key file (PEM), required when -listen-type=tls")
+	flag.StringVar(&config.TLSCAFile, "tls-ca", "", "PEM CA bundle: requires and verifies client certs when -listen-type=tls, or verifies the target's certificate when -connect-type=tls-client")
+	flag.StringVar(&config.TLSServerName, "tls-server-name", "", "SNI server name to send when -connect-type=tls-client (defaults to the connect address's host)")
+	flag.StringVar(&config.TLSALPN, "tls-alpn", "", "Comma-separated ALPN protocols to offer (tls-client) or accept (tls)")
+	flag.BoolVar(&config.TLSInsecureSkipVerify, "insecure-skip-verify", false, "Skip target certificate verification when -connect-type=tls-client")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
@@ -37,51 +61,115 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  %s -listen-type tcp -listen-addr :12347 -connect-type abstract -connect-addr webview\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -listen-type tcp -listen-addr :8080 -connect-type unix -connect-addr /tmp/socket\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -listen-type unix -listen-addr /tmp/listen.sock -connect-type tcp -connect-addr localhost:9090\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen-type udp -listen-addr :5353 -connect-type udp -connect-addr localhost:53\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -listen-type tls -listen-addr :8443 -tls-cert cert.pem -tls-key key.pem -connect-type tcp -connect-addr localhost:8080\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -config /etc/sforwarder/rules.json\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\nOptions:\n")
 		flag.PrintDefaults()
 	}
 
 	flag.Parse()
 
-	if config.ListenAddr == "" || config.ConnectAddr == "" {
-		flag.Usage()
-		os.Exit(1)
+	var rules []Rule
+	if configPath != "" {
+		loaded, err := loadRules(configPath)
+		if err != nil {
+			log.Fatalf("Failed to load config file %s: %v", configPath, err)
+		}
+		rules = loaded
+	} else {
+		if config.ListenAddr == "" || config.ConnectAddr == "" {
+			flag.Usage()
+			os.Exit(1)
+		}
+		rules = []Rule{{Name: "default", ForwardConfig: config}}
 	}
 
-	// Set up signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	log.Printf("Starting socket forwarder: %s:%s -> %s:%s",
-		config.ListenType, config.ListenAddr,
-		config.ConnectType, config.ConnectAddr)
+	supervisor := NewSupervisor(shutdownTimeout)
+	for _, rule := range rules {
+		log.Printf("Starting forward rule %q: %s:%s -> %s:%s",
+			rule.Name, rule.ListenType, rule.ListenAddr, rule.ConnectType, rule.ConnectAddr)
+		supervisor.Start(rule)
+	}
 
-	// Start the forwarder
 	go func() {
-		if err := startForwarder(config); err != nil {
-			log.Fatalf("Forwarder error: %v", err)
+		for err := range supervisor.Errors() {
+			log.Printf("Forwarder error: %v", err)
 		}
 	}()
 
-	// Wait for shutdown signal
-	<-sigChan
-	log.Println("Shutting down...")
+	// Set up signal handling: SIGINT/SIGTERM shut everything down, SIGHUP
+	// reloads TLS certificates for any "tls" rules and, in -config mode, the
+	// config file itself (single-rule flag mode has no config to reload).
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	for sig := range sigChan {
+		if sig == syscall.SIGHUP {
+			log.Printf("Reloading TLS certificates")
+			supervisor.ReloadCerts()
+
+			if configPath == "" {
+				continue
+			}
+			log.Printf("Reloading config from %s", configPath)
+			newRules, err := loadRules(configPath)
+			if err != nil {
+				log.Printf("Failed to reload config: %v", err)
+				continue
+			}
+			supervisor.Reload(newRules)
+			continue
+		}
+
+		log.Println("Shutting down...")
+		supervisor.StopAll()
+		return
+	}
+}
+
+// isDatagramType reports whether t identifies a connectionless (packet-based)
+// network, as opposed to a stream/connection-oriented one.
+func isDatagramType(t string) bool {
+	switch t {
+	case "udp", "unixgram":
+		return true
+	default:
+		return false
+	}
 }
 
-func startForwarder(config ForwardConfig) error {
+// startForwarder runs a single forward rule until stop is closed. It returns
+// nil when stopped cleanly and a non-nil error if the listener could not be
+// created or the rule configuration is invalid. certStore is required when
+// config.ListenType is "tls" and ignored otherwise.
+func startForwarder(config ForwardConfig, stop <-chan struct{}, tracker *connTracker, certStore *tlsCertStore) error {
+	if isDatagramType(config.ListenType) != isDatagramType(config.ConnectType) {
+		return fmt.Errorf("cannot mix stream and datagram forward types: listen-type %q, connect-type %q",
+			config.ListenType, config.ConnectType)
+	}
+
+	if isDatagramType(config.ListenType) {
+		return startDatagramForwarder(config, stop)
+	}
+
+	if config.ListenType == "tls" && certStore == nil {
+		return fmt.Errorf("listen type tls requires -tls-cert and -tls-key")
+	}
+
 	var listener net.Listener
 	var err error
 
 	// Create listener based on type
 	switch config.ListenType {
-	case "tcp":
+	case "tcp", "tls":
 		listener, err = net.Listen("tcp", config.ListenAddr)
-	case "unix":
+	case "unix", "unixpacket":
 		// Remove existing socket file if it exists
 		if _, err := os.Stat(config.ListenAddr); err == nil {
 			os.Remove(config.ListenAddr)
 		}
-		listener, err = net.Listen("unix", config.ListenAddr)
+		listener, err = net.Listen(config.ListenType, config.ListenAddr)
 	default:
 		return fmt.Errorf("unsupported listen type: %s", config.ListenType)
 	}
@@ -91,19 +179,49 @@ func startForwarder(config ForwardConfig) error {
 	}
 	defer listener.Close()
 
+	if config.ListenType == "tls" {
+		tlsConfig, err := buildServerTLSConfig(config, certStore)
+		if err != nil {
+			return fmt.Errorf("failed to build TLS config: %v", err)
+		}
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	go func() {
+		<-stop
+		listener.Close()
+	}()
+
 	log.Printf("Listening on %s:%s", config.ListenType, config.ListenAddr)
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
 			log.Printf("Accept error: %v", err)
 			continue
 		}
 
+		// Registered before handing off to the handler (rather than inside
+		// handleConnection) so that tracker.add happens-before this loop can
+		// ever return: stopRule waits for this loop to exit before calling
+		// tracker.drain, and drain's wg.Wait would otherwise race against an
+		// add() in a handler goroutine that hadn't run yet.
+		tracker.add(conn)
 		if config.Fork {
-			go handleConnection(conn, config)
+			go func() {
+				defer tracker.remove(conn)
+				handleConnection(conn, config)
+			}()
 		} else {
-			handleConnection(conn, config)
+			func() {
+				defer tracker.remove(conn)
+				handleConnection(conn, config)
+			}()
 		}
 	}
 }
@@ -111,11 +229,29 @@ func startForwarder(config ForwardConfig) error {
 func handleConnection(clientConn net.Conn, config ForwardConfig) {
 	defer clientConn.Close()
 
-	clientAddr := clientConn.RemoteAddr().String()
+	// Captured before accept-proxy header parsing, since send-proxy always
+	// describes the directly connected peer, not whatever address a PROXY
+	// header we accepted claimed.
+	remoteAddr := clientConn.RemoteAddr()
+	localAddr := clientConn.LocalAddr()
+	clientAddr := remoteAddr.String()
+
+	if config.AcceptProxy {
+		wrapped, realAddr, err := acceptProxyHeader(clientConn)
+		if err != nil {
+			log.Printf("Failed to parse PROXY header from %s: %v", clientAddr, err)
+			return
+		}
+		clientConn = wrapped
+		if realAddr != nil {
+			clientAddr = realAddr.String()
+		}
+	}
+
 	log.Printf("New connection from %s", clientAddr)
 
 	// Connect to target
-	targetConn, err := connectToTarget(config.ConnectType, config.ConnectAddr)
+	targetConn, err := connectToTarget(config)
 	if err != nil {
 		log.Printf("Failed to connect to target %s:%s: %v",
 			config.ConnectType, config.ConnectAddr, err)
@@ -123,39 +259,108 @@ func handleConnection(clientConn net.Conn, config ForwardConfig) {
 	}
 	defer targetConn.Close()
 
+	if config.SendProxyVersion != "" {
+		if err := writeProxyHeader(targetConn, config.SendProxyVersion, remoteAddr, localAddr); err != nil {
+			log.Printf("Failed to write PROXY header to target: %v", err)
+			return
+		}
+	}
+
 	log.Printf("Connected to target %s:%s", config.ConnectType, config.ConnectAddr)
 
-	// Start bidirectional forwarding
-	done := make(chan struct{}, 2)
+	// unixpacket is message-oriented (SOCK_SEQPACKET): io.Copy's internal
+	// buffer can merge or split reads across Write calls, which coalesces
+	// distinct packets. Use a copy loop that issues one Write per Read instead.
+	preserveBoundaries := config.ListenType == "unixpacket" || config.ConnectType == "unixpacket"
+
+	// Half-close rather than fully closing as soon as one direction hits EOF:
+	// protocols like SMTP or HTTP/1.0 shut down their request half and then
+	// wait for the rest of the response, so closing both sides here would cut
+	// that response off. Each direction instead half-closes only its own
+	// write side on clean EOF and waits for the other direction to finish;
+	// either direction erroring tears the whole connection down immediately,
+	// since there's nothing left worth draining.
+	var wg sync.WaitGroup
+	wg.Add(2)
 
-	// Forward from client to target
 	go func() {
-		defer func() { done <- struct{}{} }()
-		bytes, err := io.Copy(targetConn, clientConn)
+		defer wg.Done()
+		bytes, err := copyData(targetConn, clientConn, preserveBoundaries)
 		if err != nil {
 			log.Printf("Client->Target copy error: %v", err)
-		} else {
-			log.Printf("Client->Target: %d bytes forwarded", bytes)
+			clientConn.Close()
+			targetConn.Close()
+			return
 		}
+		log.Printf("Client->Target: %d bytes forwarded (client finished sending)", bytes)
+		closeWrite(targetConn)
 	}()
 
-	// Forward from target to client
 	go func() {
-		defer func() { done <- struct{}{} }()
-		bytes, err := io.Copy(clientConn, targetConn)
+		defer wg.Done()
+		bytes, err := copyData(clientConn, targetConn, preserveBoundaries)
 		if err != nil {
 			log.Printf("Target->Client copy error: %v", err)
-		} else {
-			log.Printf("Target->Client: %d bytes forwarded", bytes)
+			clientConn.Close()
+			targetConn.Close()
+			return
 		}
+		log.Printf("Target->Client: %d bytes forwarded (target finished sending)", bytes)
+		closeWrite(clientConn)
 	}()
 
-	// Wait for either direction to complete
-	<-done
+	// Wait for both directions to finish before the deferred Close calls run.
+	wg.Wait()
 	log.Printf("Connection from %s closed", clientAddr)
 }
 
-func connectToTarget(connectType, connectAddr string) (net.Conn, error) {
+// closeWrite half-closes conn's write side so the peer observes EOF while
+// reads on conn can still drain whatever the peer sends afterward. CloseWrite
+// (and CloseRead) aren't part of the net.Conn interface, so this type-switches
+// on the concrete types that implement it, the same way the stdlib's own
+// TestCloseRead/TestCloseWrite do; anything else just gets fully closed.
+func closeWrite(conn net.Conn) {
+	switch c := conn.(type) {
+	case *net.TCPConn:
+		c.CloseWrite()
+	case *net.UnixConn:
+		c.CloseWrite()
+	case *tls.Conn:
+		c.CloseWrite()
+	default:
+		conn.Close()
+	}
+}
+
+// copyData copies from src to dst like io.Copy, except when preserveBoundaries
+// is set: it then performs one Write per Read so that message boundaries from
+// message-oriented sockets (e.g. unixpacket) are not merged or split.
+func copyData(dst, src net.Conn, preserveBoundaries bool) (int64, error) {
+	if !preserveBoundaries {
+		return io.Copy(dst, src)
+	}
+
+	buf := make([]byte, 64*1024)
+	var total int64
+	for {
+		n, rerr := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return total, werr
+			}
+			total += int64(n)
+		}
+		if rerr != nil {
+			if rerr == io.EOF {
+				return total, nil
+			}
+			return total, rerr
+		}
+	}
+}
+
+func connectToTarget(config ForwardConfig) (net.Conn, error) {
+	connectType, connectAddr := config.ConnectType, config.ConnectAddr
 	var conn net.Conn
 	var err error
 
@@ -172,9 +377,210 @@ func connectToTarget(connectType, connectAddr string) (net.Conn, error) {
 			addr = "@" + addr
 		}
 		conn, err = net.DialTimeout("unix", addr, 10*time.Second)
+	case "unixpacket":
+		conn, err = net.DialTimeout("unixpacket", connectAddr, 10*time.Second)
+	case "udp":
+		conn, err = net.DialTimeout("udp", connectAddr, 10*time.Second)
+	case "unixgram":
+		conn, err = net.DialTimeout("unixgram", connectAddr, 10*time.Second)
+	case "tls-client":
+		tlsConfig, cfgErr := buildClientTLSConfig(config)
+		if cfgErr != nil {
+			return nil, fmt.Errorf("failed to build TLS config: %v", cfgErr)
+		}
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		conn, err = tls.DialWithDialer(dialer, "tcp", connectAddr, tlsConfig)
 	default:
 		return nil, fmt.Errorf("unsupported connect type: %s", connectType)
 	}
 
 	return conn, err
 }
+
+// startDatagramForwarder handles the udp/unixgram case, where there is no
+// accept loop: a single PacketConn receives datagrams from any client, and a
+// NAT-style session table maps each client address to its own dialed target
+// connection so that responses can be routed back to the right client.
+func startDatagramForwarder(config ForwardConfig, stop <-chan struct{}) error {
+	listenConn, err := listenPacket(config.ListenType, config.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to create packet listener: %v", err)
+	}
+	defer listenConn.Close()
+
+	go func() {
+		<-stop
+		listenConn.Close()
+	}()
+
+	log.Printf("Listening on %s:%s (datagram)", config.ListenType, config.ListenAddr)
+
+	idleTimeout := config.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = 60 * time.Second
+	}
+
+	sessions := &datagramSessions{m: make(map[string]*datagramSession)}
+
+	cleanup := time.NewTicker(idleTimeout / 2)
+	defer cleanup.Stop()
+	go func() {
+		for {
+			select {
+			case <-cleanup.C:
+				sessions.evictIdle(idleTimeout)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, clientAddr, err := listenConn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-stop:
+				// Force-close every live session's target connection so its
+				// pumpTargetToClient goroutine observes an error and exits,
+				// the same way connTracker.drain force-unblocks stream
+				// connections on shutdown.
+				sessions.closeAll()
+				return nil
+			default:
+			}
+			log.Printf("Datagram read error: %v", err)
+			continue
+		}
+
+		sess, err := sessions.get(clientAddr, config, listenConn)
+		if err != nil {
+			log.Printf("Failed to connect to target for %s: %v", clientAddr, err)
+			continue
+		}
+
+		if _, err := sess.targetConn.Write(buf[:n]); err != nil {
+			log.Printf("Failed to forward datagram to target for %s: %v", clientAddr, err)
+		}
+	}
+}
+
+// listenPacket creates the PacketConn a datagram forwarder reads client
+// traffic from, removing a stale socket file for unixgram first.
+func listenPacket(listenType, listenAddr string) (net.PacketConn, error) {
+	switch listenType {
+	case "udp":
+		return net.ListenPacket("udp", listenAddr)
+	case "unixgram":
+		if _, err := os.Stat(listenAddr); err == nil {
+			os.Remove(listenAddr)
+		}
+		return net.ListenPacket("unixgram", listenAddr)
+	default:
+		return nil, fmt.Errorf("unsupported datagram listen type: %s", listenType)
+	}
+}
+
+// datagramSession tracks the dialed target connection for one client address
+// and when it was last used, so idle sessions can be evicted.
+type datagramSession struct {
+	targetConn net.Conn
+	lastActive time.Time
+}
+
+// datagramSessions is the NAT-style table mapping client address -> session.
+type datagramSessions struct {
+	mu sync.Mutex
+	m  map[string]*datagramSession
+}
+
+// get returns the existing session for clientAddr, or dials a fresh target
+// connection and starts its target->client return goroutine if this is the
+// first datagram seen from that client.
+func (s *datagramSessions) get(clientAddr net.Addr, config ForwardConfig, listenConn net.PacketConn) (*datagramSession, error) {
+	key := clientAddr.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess, ok := s.m[key]; ok {
+		sess.lastActive = time.Now()
+		return sess, nil
+	}
+
+	targetConn, err := connectToTarget(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &datagramSession{targetConn: targetConn, lastActive: time.Now()}
+	s.m[key] = sess
+	log.Printf("New datagram session from %s", key)
+
+	go s.pumpTargetToClient(key, clientAddr, sess, listenConn)
+
+	return sess, nil
+}
+
+// pumpTargetToClient reads responses from a session's target connection and
+// writes them back to the originating client address until the target
+// connection fails or is evicted.
+func (s *datagramSessions) pumpTargetToClient(key string, clientAddr net.Addr, sess *datagramSession, listenConn net.PacketConn) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := sess.targetConn.Read(buf)
+		if n > 0 {
+			if _, werr := listenConn.WriteTo(buf[:n], clientAddr); werr != nil {
+				log.Printf("Datagram write-back error for %s: %v", key, werr)
+				s.remove(key, sess)
+				return
+			}
+			s.mu.Lock()
+			sess.lastActive = time.Now()
+			s.mu.Unlock()
+		}
+		if err != nil {
+			s.remove(key, sess)
+			return
+		}
+	}
+}
+
+// evictIdle closes and removes every session whose last activity is older
+// than idleTimeout.
+func (s *datagramSessions) evictIdle(idleTimeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, sess := range s.m {
+		if time.Since(sess.lastActive) > idleTimeout {
+			sess.targetConn.Close()
+			delete(s.m, key)
+			log.Printf("Evicted idle datagram session from %s", key)
+		}
+	}
+}
+
+// closeAll closes every session's target connection without removing it from
+// the table, so each blocked pumpTargetToClient goroutine unblocks with an
+// error and removes its own session as it exits.
+func (s *datagramSessions) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sess := range s.m {
+		sess.targetConn.Close()
+	}
+}
+
+// remove closes sess's target connection and removes it from the table, if
+// it hasn't already been replaced by a newer session for the same key.
+func (s *datagramSessions) remove(key string, sess *datagramSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.m[key]; ok && current == sess {
+		delete(s.m, key)
+	}
+	sess.targetConn.Close()
+}
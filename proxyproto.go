@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// proxyV2Sig is the fixed 12-byte signature that opens every PROXY protocol
+// v2 header: "\r\n\r\n\x00\r\nQUIT\n".
+var proxyV2Sig = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// proxyConn wraps an accepted connection whose PROXY header has already been
+// consumed off a buffered reader, so the remaining buffered bytes (and
+// anything read after) are still delivered through the normal Read path.
+type proxyConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// acceptProxyHeader parses a PROXY protocol v1 or v2 header off the front of
+// conn and returns a conn that picks up right after it, plus the real client
+// address the header carried (nil for "UNKNOWN"/LOCAL headers, which carry
+// none, and for v2 headers whose address family is neither IPv4 nor IPv6).
+func acceptProxyHeader(conn net.Conn) (net.Conn, net.Addr, error) {
+	br := bufio.NewReader(conn)
+
+	if sig, err := br.Peek(len(proxyV2Sig)); err == nil && bytes.Equal(sig, proxyV2Sig) {
+		return parseProxyV2(conn, br)
+	}
+
+	return parseProxyV1(conn, br)
+}
+
+// parseProxyV1 parses the ASCII PROXY v1 header, e.g.
+// "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n" or "PROXY UNKNOWN\r\n".
+func parseProxyV1(conn net.Conn, br *bufio.Reader) (net.Conn, net.Addr, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading PROXY v1 header: %w", err)
+	}
+
+	fields := strings.Fields(strings.TrimRight(line, "\r\n"))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, nil, fmt.Errorf("invalid PROXY v1 header: %q", line)
+	}
+
+	wrapped := &proxyConn{Conn: conn, r: br}
+
+	if fields[1] == "UNKNOWN" {
+		return wrapped, nil, nil
+	}
+
+	if len(fields) != 6 {
+		return nil, nil, fmt.Errorf("invalid PROXY v1 header: %q", line)
+	}
+
+	srcAddr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(fields[2], fields[4]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid PROXY v1 source address: %w", err)
+	}
+
+	return wrapped, srcAddr, nil
+}
+
+// parseProxyV2 parses the binary PROXY v2 header following the signature:
+// a version/command byte, a family/protocol byte, a 2-byte length, and an
+// address block of that length.
+func parseProxyV2(conn net.Conn, br *bufio.Reader) (net.Conn, net.Addr, error) {
+	header := make([]byte, len(proxyV2Sig)+4)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, nil, fmt.Errorf("reading PROXY v2 header: %w", err)
+	}
+
+	versionCommand := header[len(proxyV2Sig)]
+	familyProto := header[len(proxyV2Sig)+1]
+	length := binary.BigEndian.Uint16(header[len(proxyV2Sig)+2:])
+
+	addrBlock := make([]byte, length)
+	if length > 0 {
+		if _, err := io.ReadFull(br, addrBlock); err != nil {
+			return nil, nil, fmt.Errorf("reading PROXY v2 address block: %w", err)
+		}
+	}
+
+	wrapped := &proxyConn{Conn: conn, r: br}
+
+	if command := versionCommand & 0x0F; command == 0x0 {
+		// LOCAL: health check / keepalive with no real address to report.
+		return wrapped, nil, nil
+	}
+
+	switch family := familyProto >> 4; family {
+	case 0x1: // AF_INET
+		if len(addrBlock) < 12 {
+			return nil, nil, fmt.Errorf("short PROXY v2 IPv4 address block")
+		}
+		return wrapped, &net.TCPAddr{
+			IP:   net.IP(addrBlock[0:4]),
+			Port: int(binary.BigEndian.Uint16(addrBlock[8:10])),
+		}, nil
+	case 0x2: // AF_INET6
+		if len(addrBlock) < 36 {
+			return nil, nil, fmt.Errorf("short PROXY v2 IPv6 address block")
+		}
+		return wrapped, &net.TCPAddr{
+			IP:   net.IP(addrBlock[0:16]),
+			Port: int(binary.BigEndian.Uint16(addrBlock[32:34])),
+		}, nil
+	default:
+		// AF_UNSPEC or AF_UNIX: no TCP address to surface.
+		return wrapped, nil, nil
+	}
+}
+
+// writeProxyHeader emits a PROXY protocol header for src/dst onto w before
+// any forwarded data, so the target sees the real client address.
+func writeProxyHeader(w io.Writer, version string, src, dst net.Addr) error {
+	switch version {
+	case "v1":
+		return writeProxyV1(w, src, dst)
+	case "v2":
+		return writeProxyV2(w, src, dst)
+	default:
+		return fmt.Errorf("unsupported PROXY protocol version: %s", version)
+	}
+}
+
+// tcpAddrPair reports whether src and dst are both TCP addresses of the same
+// IP family, the only case PROXY v1/v2 can describe precisely.
+func tcpAddrPair(src, dst net.Addr) (srcTCP, dstTCP *net.TCPAddr, ok bool) {
+	s, sok := src.(*net.TCPAddr)
+	d, dok := dst.(*net.TCPAddr)
+	if !sok || !dok || (s.IP.To4() == nil) != (d.IP.To4() == nil) {
+		return nil, nil, false
+	}
+	return s, d, true
+}
+
+func writeProxyV1(w io.Writer, src, dst net.Addr) error {
+	s, d, ok := tcpAddrPair(src, dst)
+	if !ok {
+		_, err := io.WriteString(w, "PROXY UNKNOWN\r\n")
+		return err
+	}
+
+	proto := "TCP4"
+	if s.IP.To4() == nil {
+		proto = "TCP6"
+	}
+
+	_, err := fmt.Fprintf(w, "PROXY %s %s %s %d %d\r\n", proto, s.IP.String(), d.IP.String(), s.Port, d.Port)
+	return err
+}
+
+func writeProxyV2(w io.Writer, src, dst net.Addr) error {
+	s, d, ok := tcpAddrPair(src, dst)
+	if !ok {
+		// LOCAL command: no address block, e.g. when the listen side is a
+		// unix/abstract socket and there's no TCP peer address to report.
+		header := append(append([]byte{}, proxyV2Sig...), 0x20, 0x00, 0x00, 0x00)
+		_, err := w.Write(header)
+		return err
+	}
+
+	family := byte(0x1)
+	srcIP, dstIP := s.IP.To4(), d.IP.To4()
+	if srcIP == nil {
+		family = 0x2
+		srcIP, dstIP = s.IP.To16(), d.IP.To16()
+	}
+
+	addr := make([]byte, 0, len(srcIP)+len(dstIP)+4)
+	addr = append(addr, srcIP...)
+	addr = append(addr, dstIP...)
+	addr = binary.BigEndian.AppendUint16(addr, uint16(s.Port))
+	addr = binary.BigEndian.AppendUint16(addr, uint16(d.Port))
+
+	header := append(append([]byte{}, proxyV2Sig...), 0x21, family<<4|0x1)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addr)))
+	header = append(header, addr...)
+
+	_, err := w.Write(header)
+	return err
+}
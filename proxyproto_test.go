@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestAcceptProxyHeader_V1TCP4(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		client.Write([]byte("PROXY TCP4 10.0.0.1 10.0.0.2 1234 443\r\nHELLO"))
+	}()
+
+	wrapped, addr, err := acceptProxyHeader(server)
+	if err != nil {
+		t.Fatalf("acceptProxyHeader returned error: %v", err)
+	}
+
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("Expected *net.TCPAddr, got %T", addr)
+	}
+	if tcpAddr.IP.String() != "10.0.0.1" || tcpAddr.Port != 1234 {
+		t.Errorf("Expected 10.0.0.1:1234, got %s:%d", tcpAddr.IP, tcpAddr.Port)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(wrapped, buf); err != nil {
+		t.Fatalf("Failed to read remaining body: %v", err)
+	}
+	if string(buf) != "HELLO" {
+		t.Errorf("Expected remaining body %q, got %q", "HELLO", string(buf))
+	}
+}
+
+func TestAcceptProxyHeader_V1Unknown(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		client.Write([]byte("PROXY UNKNOWN\r\nBODY"))
+	}()
+
+	wrapped, addr, err := acceptProxyHeader(server)
+	if err != nil {
+		t.Fatalf("acceptProxyHeader returned error: %v", err)
+	}
+	if addr != nil {
+		t.Errorf("Expected nil address for UNKNOWN header, got %v", addr)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(wrapped, buf); err != nil {
+		t.Fatalf("Failed to read remaining body: %v", err)
+	}
+	if string(buf) != "BODY" {
+		t.Errorf("Expected remaining body %q, got %q", "BODY", string(buf))
+	}
+}
+
+func TestWriteProxyV1(t *testing.T) {
+	var buf bytes.Buffer
+	src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 443}
+
+	if err := writeProxyHeader(&buf, "v1", src, dst); err != nil {
+		t.Fatalf("writeProxyHeader returned error: %v", err)
+	}
+
+	expected := "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestWriteProxyV1_NonTCPFallsBackToUnknown(t *testing.T) {
+	var buf bytes.Buffer
+	src := &net.UnixAddr{Name: "/tmp/client.sock", Net: "unix"}
+	dst := &net.UnixAddr{Name: "/tmp/server.sock", Net: "unix"}
+
+	if err := writeProxyHeader(&buf, "v1", src, dst); err != nil {
+		t.Fatalf("writeProxyHeader returned error: %v", err)
+	}
+
+	if buf.String() != "PROXY UNKNOWN\r\n" {
+		t.Errorf("Expected PROXY UNKNOWN, got %q", buf.String())
+	}
+}
+
+func TestProxyV2_WriteAndParseRoundTrip(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	src := &net.TCPAddr{IP: net.ParseIP("198.51.100.5"), Port: 9000}
+	dst := &net.TCPAddr{IP: net.ParseIP("198.51.100.6"), Port: 443}
+
+	go func() {
+		writeProxyHeader(client, "v2", src, dst)
+		client.Write([]byte("PAYLOAD"))
+	}()
+
+	wrapped, addr, err := acceptProxyHeader(server)
+	if err != nil {
+		t.Fatalf("acceptProxyHeader returned error: %v", err)
+	}
+
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("Expected *net.TCPAddr, got %T", addr)
+	}
+	if !tcpAddr.IP.Equal(src.IP) || tcpAddr.Port != src.Port {
+		t.Errorf("Expected %s, got %s", src, tcpAddr)
+	}
+
+	buf := make([]byte, len("PAYLOAD"))
+	if _, err := io.ReadFull(wrapped, buf); err != nil {
+		t.Fatalf("Failed to read remaining body: %v", err)
+	}
+	if string(buf) != "PAYLOAD" {
+		t.Errorf("Expected remaining body %q, got %q", "PAYLOAD", string(buf))
+	}
+}
+
+func TestWriteProxyV2_NonTCPEmitsLocal(t *testing.T) {
+	var buf bytes.Buffer
+	src := &net.UnixAddr{Name: "/tmp/client.sock", Net: "unix"}
+	dst := &net.UnixAddr{Name: "/tmp/server.sock", Net: "unix"}
+
+	if err := writeProxyHeader(&buf, "v2", src, dst); err != nil {
+		t.Fatalf("writeProxyHeader returned error: %v", err)
+	}
+
+	expected := append(append([]byte{}, proxyV2Sig...), 0x20, 0x00, 0x00, 0x00)
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("Expected LOCAL v2 header %x, got %x", expected, buf.Bytes())
+	}
+}
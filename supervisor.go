@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Rule is a single named forward rule, as loaded from a config file or built
+// from the single-rule command-line flags.
+type Rule struct {
+	Name string
+	ForwardConfig
+}
+
+// Supervisor owns every running forward rule. It starts and stops the
+// listener goroutine behind each rule, aggregates their errors onto a single
+// channel, and can reconcile a new set of rules against what is currently
+// running (see Reload).
+type Supervisor struct {
+	mu              sync.Mutex
+	rules           map[string]Rule
+	stopChs         map[string]chan struct{}
+	doneChs         map[string]chan struct{}
+	trackers        map[string]*connTracker
+	certStores      map[string]*tlsCertStore
+	shutdownTimeout time.Duration
+	errCh           chan error
+}
+
+// NewSupervisor returns an empty Supervisor ready to have rules started on
+// it. shutdownTimeout bounds how long StopAll/stopRule wait for a rule's
+// in-flight connections to finish before forcibly closing them.
+func NewSupervisor(shutdownTimeout time.Duration) *Supervisor {
+	return &Supervisor{
+		rules:           make(map[string]Rule),
+		stopChs:         make(map[string]chan struct{}),
+		doneChs:         make(map[string]chan struct{}),
+		trackers:        make(map[string]*connTracker),
+		certStores:      make(map[string]*tlsCertStore),
+		shutdownTimeout: shutdownTimeout,
+		errCh:           make(chan error, 16),
+	}
+}
+
+// Errors returns the channel forwarder errors are published on. It is never
+// closed; callers should range over it in a dedicated goroutine.
+func (s *Supervisor) Errors() <-chan error {
+	return s.errCh
+}
+
+// Start runs rule's listener in its own goroutine. If a rule with the same
+// name is already running, it is stopped first.
+func (s *Supervisor) Start(rule Rule) {
+	s.stopRule(rule.Name)
+
+	var certStore *tlsCertStore
+	if rule.ListenType == "tls" {
+		store, err := newTLSCertStore(rule.TLSCertFile, rule.TLSKeyFile)
+		if err != nil {
+			s.errCh <- fmt.Errorf("rule %q: %w", rule.Name, err)
+			return
+		}
+		certStore = store
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	tracker := newConnTracker()
+
+	s.mu.Lock()
+	s.rules[rule.Name] = rule
+	s.stopChs[rule.Name] = stop
+	s.doneChs[rule.Name] = done
+	s.trackers[rule.Name] = tracker
+	if certStore != nil {
+		s.certStores[rule.Name] = certStore
+	}
+	s.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		if err := startForwarder(rule.ForwardConfig, stop, tracker, certStore); err != nil {
+			s.errCh <- fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+	}()
+}
+
+// StopAll stops every running rule and waits for its listener goroutine to
+// return.
+func (s *Supervisor) StopAll() {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.stopChs))
+	for name := range s.stopChs {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+
+	for _, name := range names {
+		s.stopRule(name)
+	}
+}
+
+// stopRule stops the named rule, if running: it closes its listener, waits
+// up to the supervisor's shutdown timeout for in-flight connections to
+// finish on their own, and force-closes whatever is left after that.
+func (s *Supervisor) stopRule(name string) {
+	s.mu.Lock()
+	stop, ok := s.stopChs[name]
+	done := s.doneChs[name]
+	tracker := s.trackers[name]
+	if ok {
+		delete(s.rules, name)
+		delete(s.stopChs, name)
+		delete(s.doneChs, name)
+		delete(s.trackers, name)
+		delete(s.certStores, name)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	close(stop)
+	<-done
+
+	if forced := tracker.drain(s.shutdownTimeout); forced > 0 {
+		log.Printf("Rule %q: force-closed %d connection(s) still in flight after shutdown timeout", name, forced)
+	}
+}
+
+// ReloadCerts re-reads the certificate and key from disk for every running
+// "tls" rule, so a SIGHUP can roll a renewed certificate into the running
+// process without restarting any listener.
+func (s *Supervisor) ReloadCerts() {
+	s.mu.Lock()
+	stores := make([]*tlsCertStore, 0, len(s.certStores))
+	for _, store := range s.certStores {
+		stores = append(stores, store)
+	}
+	s.mu.Unlock()
+
+	for _, store := range stores {
+		if err := store.reload(); err != nil {
+			log.Printf("Failed to reload TLS certificate: %v", err)
+		}
+	}
+}
+
+// Reload reconciles newRules against the rules currently running: rules that
+// were removed or whose config changed are stopped (in-flight connections on
+// unrelated rules are left untouched), rules that are new or changed are
+// (re)started, and rules that are unchanged are left exactly as they are.
+func (s *Supervisor) Reload(newRules []Rule) {
+	s.mu.Lock()
+	current := make(map[string]Rule, len(s.rules))
+	for name, rule := range s.rules {
+		current[name] = rule
+	}
+	s.mu.Unlock()
+
+	byName := make(map[string]Rule, len(newRules))
+	for _, rule := range newRules {
+		byName[rule.Name] = rule
+	}
+
+	for name, oldRule := range current {
+		newRule, stillPresent := byName[name]
+		if !stillPresent || newRule.ForwardConfig != oldRule.ForwardConfig {
+			log.Printf("Stopping rule %q for reload", name)
+			s.stopRule(name)
+		}
+	}
+
+	for name, newRule := range byName {
+		if oldRule, existed := current[name]; existed && oldRule.ForwardConfig == newRule.ForwardConfig {
+			continue
+		}
+		log.Printf("Starting rule %q from reload", name)
+		s.Start(newRule)
+	}
+}
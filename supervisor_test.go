@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+
+	cf := configFile{
+		Rules: []ruleFile{
+			{Name: "web", ListenType: "tcp", ListenAddr: ":8080", ConnectType: "unix", ConnectAddr: "/tmp/web.sock"},
+			{ListenType: "tcp", ListenAddr: ":8081", ConnectType: "tcp", ConnectAddr: "localhost:9090", IdleTimeout: "30s"},
+		},
+	}
+
+	data, err := json.Marshal(cf)
+	if err != nil {
+		t.Fatalf("Failed to marshal test config: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	rules, err := loadRules(path)
+	if err != nil {
+		t.Fatalf("loadRules returned error: %v", err)
+	}
+
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(rules))
+	}
+
+	if rules[0].Name != "web" {
+		t.Errorf("Expected first rule name %q, got %q", "web", rules[0].Name)
+	}
+	if rules[1].Name != "rule-1" {
+		t.Errorf("Expected second rule to default its name to %q, got %q", "rule-1", rules[1].Name)
+	}
+	if rules[1].IdleTimeout != 30*time.Second {
+		t.Errorf("Expected idle timeout 30s, got %v", rules[1].IdleTimeout)
+	}
+	if !rules[0].Fork {
+		t.Errorf("Expected Fork to default to true")
+	}
+}
+
+func TestLoadRules_DuplicateName(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+
+	cf := configFile{
+		Rules: []ruleFile{
+			{Name: "dup", ListenType: "tcp", ListenAddr: ":8080", ConnectType: "tcp", ConnectAddr: "localhost:1"},
+			{Name: "dup", ListenType: "tcp", ListenAddr: ":8081", ConnectType: "tcp", ConnectAddr: "localhost:2"},
+		},
+	}
+	data, _ := json.Marshal(cf)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	if _, err := loadRules(path); err == nil {
+		t.Fatal("Expected error for duplicate rule names")
+	}
+}
+
+func TestSupervisor_StartAndStopAll(t *testing.T) {
+	targetListener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to create target server: %v", err)
+	}
+	defer targetListener.Close()
+	go func() {
+		for {
+			conn, err := targetListener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	port, err := findFreePort()
+	if err != nil {
+		t.Fatalf("Failed to find free port: %v", err)
+	}
+
+	rule := Rule{
+		Name: "test-rule",
+		ForwardConfig: ForwardConfig{
+			ListenType:  "tcp",
+			ListenAddr:  fmt.Sprintf(":%d", port),
+			ConnectType: "tcp",
+			ConnectAddr: targetListener.Addr().String(),
+			Fork:        true,
+		},
+	}
+
+	s := NewSupervisor(2 * time.Second)
+	s.Start(rule)
+
+	addr := fmt.Sprintf("localhost:%d", port)
+	if err := waitForListener(addr, 2*time.Second); err != nil {
+		t.Fatalf("Rule failed to start: %v", err)
+	}
+
+	s.StopAll()
+
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("Expected listener to be closed after StopAll")
+	}
+}
+
+func TestSupervisor_ReloadLeavesUnchangedRuleRunning(t *testing.T) {
+	targetListener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to create target server: %v", err)
+	}
+	defer targetListener.Close()
+	go func() {
+		for {
+			conn, err := targetListener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	port, err := findFreePort()
+	if err != nil {
+		t.Fatalf("Failed to find free port: %v", err)
+	}
+
+	rule := Rule{
+		Name: "stable",
+		ForwardConfig: ForwardConfig{
+			ListenType:  "tcp",
+			ListenAddr:  fmt.Sprintf(":%d", port),
+			ConnectType: "tcp",
+			ConnectAddr: targetListener.Addr().String(),
+			Fork:        true,
+		},
+	}
+
+	s := NewSupervisor(2 * time.Second)
+	s.Start(rule)
+	defer s.StopAll()
+
+	addr := fmt.Sprintf("localhost:%d", port)
+	if err := waitForListener(addr, 2*time.Second); err != nil {
+		t.Fatalf("Rule failed to start: %v", err)
+	}
+
+	s.mu.Lock()
+	stopBefore := s.stopChs["stable"]
+	s.mu.Unlock()
+
+	s.Reload([]Rule{rule})
+
+	s.mu.Lock()
+	stopAfter := s.stopChs["stable"]
+	s.mu.Unlock()
+
+	if stopBefore != stopAfter {
+		t.Error("Expected unchanged rule to keep running without being restarted")
+	}
+}
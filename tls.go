@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// tlsCertStore holds the server certificate for a "tls" listen rule behind
+// an atomic pointer, so tls.Config.GetCertificate can keep handing out the
+// current certificate while reload() swaps in a freshly-read one from disk
+// (driven by a SIGHUP, see Supervisor.ReloadCerts) without disrupting
+// in-flight handshakes.
+type tlsCertStore struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+}
+
+// newTLSCertStore loads certFile/keyFile once up front so misconfiguration
+// is reported at rule-start time rather than on the first handshake.
+func newTLSCertStore(certFile, keyFile string) (*tlsCertStore, error) {
+	store := &tlsCertStore{certFile: certFile, keyFile: keyFile}
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// reload re-reads the certificate and key from disk and swaps them in.
+func (s *tlsCertStore) reload() error {
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate %s / %s: %v", s.certFile, s.keyFile, err)
+	}
+	s.cert.Store(&cert)
+	return nil
+}
+
+func (s *tlsCertStore) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.cert.Load(), nil
+}
+
+// buildServerTLSConfig builds the tls.Config for a "tls" listen rule.
+// Presenting a CA bundle turns on mutual TLS, requiring and verifying a
+// client certificate.
+func buildServerTLSConfig(config ForwardConfig, store *tlsCertStore) (*tls.Config, error) {
+	cfg := &tls.Config{GetCertificate: store.getCertificate}
+
+	if protos := parseALPN(config.TLSALPN); len(protos) > 0 {
+		cfg.NextProtos = protos
+	}
+
+	if config.TLSCAFile != "" {
+		pool, err := loadCertPool(config.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// buildClientTLSConfig builds the tls.Config for a "tls-client" connect
+// rule. ServerName defaults to the connect address's host when not set
+// explicitly, so SNI is sent correctly without extra configuration.
+func buildClientTLSConfig(config ForwardConfig) (*tls.Config, error) {
+	serverName := config.TLSServerName
+	if serverName == "" {
+		if host, _, err := net.SplitHostPort(config.ConnectAddr); err == nil {
+			serverName = host
+		}
+	}
+
+	cfg := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: config.TLSInsecureSkipVerify,
+	}
+
+	if protos := parseALPN(config.TLSALPN); len(protos) > 0 {
+		cfg.NextProtos = protos
+	}
+
+	if config.TLSCAFile != "" {
+		pool, err := loadCertPool(config.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// parseALPN splits a comma-separated ALPN protocol list, trimming whitespace
+// and dropping empty entries.
+func parseALPN(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	fields := strings.Split(s, ",")
+	protos := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			protos = append(protos, f)
+		}
+	}
+	return protos
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file %s: %v", path, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", path)
+	}
+	return pool, nil
+}
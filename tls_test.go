@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// generateTestCert writes a self-signed certificate/key pair valid for
+// "localhost" to a temp dir and returns their paths.
+func generateTestCert(t *testing.T) (certPath, keyPath string) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("Failed to generate serial number: %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certPath = filepath.Join(dir, "cert.pem")
+	keyPath = filepath.Join(dir, "key.pem")
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write cert: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	return certPath, keyPath
+}
+
+func TestTLSTerminatingForwarder(t *testing.T) {
+	certPath, keyPath := generateTestCert(t)
+
+	// Plain TCP target the forwarder terminates TLS in front of.
+	targetListener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to create target server: %v", err)
+	}
+	defer targetListener.Close()
+	targetAddr := targetListener.Addr().String()
+
+	go func() {
+		for {
+			conn, err := targetListener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				io.Copy(c, c)
+			}(conn)
+		}
+	}()
+
+	forwarderPort, err := findFreePort()
+	if err != nil {
+		t.Fatalf("Failed to find free port: %v", err)
+	}
+	forwarderAddr := fmt.Sprintf("localhost:%d", forwarderPort)
+
+	config := ForwardConfig{
+		ListenType:  "tls",
+		ListenAddr:  fmt.Sprintf(":%d", forwarderPort),
+		ConnectType: "tcp",
+		ConnectAddr: targetAddr,
+		Fork:        true,
+		TLSCertFile: certPath,
+		TLSKeyFile:  keyPath,
+	}
+
+	go startForwarder(config, make(chan struct{}), newConnTracker(), mustCertStore(t, certPath, keyPath))
+
+	if err := waitForListener(forwarderAddr, 2*time.Second); err != nil {
+		t.Fatalf("Forwarder failed to start: %v", err)
+	}
+
+	client, err := tls.Dial("tcp", forwarderAddr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to dial TLS forwarder: %v", err)
+	}
+	defer client.Close()
+
+	testData := "Hello over TLS!"
+	if _, err := client.Write([]byte(testData)); err != nil {
+		t.Fatalf("Failed to write test data: %v", err)
+	}
+
+	buffer := make([]byte, len(testData))
+	if _, err := io.ReadFull(client, buffer); err != nil {
+		t.Fatalf("Failed to read echoed data: %v", err)
+	}
+	if string(buffer) != testData {
+		t.Errorf("Expected %q, got %q", testData, string(buffer))
+	}
+}
+
+func TestTLSOriginatingForwarder(t *testing.T) {
+	certPath, keyPath := generateTestCert(t)
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load test cert: %v", err)
+	}
+
+	// TLS target the forwarder originates a tls-client connection to.
+	targetListener, err := tls.Listen("tcp", ":0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Failed to create TLS target server: %v", err)
+	}
+	defer targetListener.Close()
+	targetAddr := targetListener.Addr().String()
+
+	go func() {
+		for {
+			conn, err := targetListener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				io.Copy(c, c)
+			}(conn)
+		}
+	}()
+
+	forwarderPort, err := findFreePort()
+	if err != nil {
+		t.Fatalf("Failed to find free port: %v", err)
+	}
+	forwarderAddr := fmt.Sprintf("localhost:%d", forwarderPort)
+
+	config := ForwardConfig{
+		ListenType:            "tcp",
+		ListenAddr:            fmt.Sprintf(":%d", forwarderPort),
+		ConnectType:           "tls-client",
+		ConnectAddr:           targetAddr,
+		Fork:                  true,
+		TLSInsecureSkipVerify: true,
+	}
+
+	go startForwarder(config, make(chan struct{}), newConnTracker(), nil)
+
+	if err := waitForListener(forwarderAddr, 2*time.Second); err != nil {
+		t.Fatalf("Forwarder failed to start: %v", err)
+	}
+
+	client, err := net.Dial("tcp", forwarderAddr)
+	if err != nil {
+		t.Fatalf("Failed to dial forwarder: %v", err)
+	}
+	defer client.Close()
+
+	testData := "Hello through TLS origination!"
+	if _, err := client.Write([]byte(testData)); err != nil {
+		t.Fatalf("Failed to write test data: %v", err)
+	}
+
+	buffer := make([]byte, len(testData))
+	if _, err := io.ReadFull(client, buffer); err != nil {
+		t.Fatalf("Failed to read echoed data: %v", err)
+	}
+	if string(buffer) != testData {
+		t.Errorf("Expected %q, got %q", testData, string(buffer))
+	}
+}
+
+func mustCertStore(t *testing.T, certPath, keyPath string) *tlsCertStore {
+	t.Helper()
+	store, err := newTLSCertStore(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("Failed to build TLS cert store: %v", err)
+	}
+	return store
+}